@@ -26,6 +26,8 @@ import (
 	"github.com/pingcap/kvproto/pkg/diagnosticspb"
 	"github.com/pingcap/sysutil"
 	"google.golang.org/grpc"
+
+	"github.com/pingcap/tidb-dashboard/pkg/utils"
 )
 
 type ReqInfo struct {
@@ -33,6 +35,7 @@ type ReqInfo struct {
 	ip         string
 	port       string
 	req        *diagnosticspb.SearchLogRequest
+	security   *utils.SecurityConfig
 }
 
 func (r *ReqInfo) address() string {
@@ -128,7 +131,11 @@ const PreviewLogLinesLimit = 100
 func (t *Task) run(ctx context.Context) {
 	defer t.close()
 	ctx, t.cancel = context.WithCancel(ctx)
-	opt := grpc.WithInsecure()
+	opt, err := t.security.DialOption()
+	if err != nil {
+		t.err = err
+		return
+	}
 
 	conn, err := grpc.Dial(t.address(), opt)
 	if err != nil {
@@ -0,0 +1,136 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"google.golang.org/grpc"
+
+	"github.com/pingcap/tidb-dashboard/pkg/utils"
+)
+
+// RetryPolicy bounds how Task.run retries a SearchLog stream that failed with a transient
+// gRPC error instead of giving up and letting the partial zip be deleted by clean().
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is applied by Task.run when the TaskModel's RetryPolicy has MaxAttempts 0.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << uint(attempt)
+	if d > p.MaxBackoff || d <= 0 {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// checkpointEvery is how many written lines pass between persisting LastTimestamp while a
+// Task is streaming, so a resumed task re-reads fewer than checkpointEvery already-seen lines.
+const checkpointEvery = 200
+
+// checkpoint records the last successfully written message time into the TaskModel so
+// Resume can pick up from here after an interruption.
+func (t *Task) checkpoint(msgTime int64) {
+	t.LastTimestamp = msgTime
+	t.mu.Lock()
+	dbClient.updateTask(t.TaskModel)
+	t.mu.Unlock()
+}
+
+// effectiveStartTime is where the next SearchLog dial (initial or retry) should resume
+// from: never earlier than the caller's original request, but picking up right after
+// LastTimestamp once a checkpoint exists, so a reconnect neither re-queries from the
+// beginning of time nor silently ignores StartTime on the very first, pre-checkpoint retry.
+func (t *Task) effectiveStartTime() int64 {
+	if t.LastTimestamp+1 > t.Request.StartTime {
+		return t.LastTimestamp + 1
+	}
+	return t.Request.StartTime
+}
+
+// dial opens a gRPC connection and SearchLog stream starting at startTime, which is
+// LastTimestamp+1 on a resumed task and the original request's StartTime otherwise.
+func (t *Task) dial(ctx context.Context, startTime int64) (*grpc.ClientConn, diagnosticspb.Diagnostics_SearchLogClient, error) {
+	opt, err := t.Component.Security.DialOption()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := grpc.Dial(t.Component.address(), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := (*diagnosticspb.SearchLogRequest)(t.Request)
+	req.StartTime = startTime
+	cli := diagnosticspb.NewDiagnosticsClient(conn)
+	stream, err := cli.SearchLog(ctx, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, stream, nil
+}
+
+// reopenForAppend opens a new zip alongside t.SavedPath to hold a continuation of the log,
+// since archive/zip does not support appending to an entry that was already closed. The
+// locator is added to t.SavedPathFragments rather than replacing t.SavedPath, so every
+// fragment written before and after the interruption stays reachable through SavedPaths()
+// and gets cleaned up by clean() instead of leaking.
+func (t *Task) reopenForAppend(attempt int) (f io.WriteCloser, zw *zip.Writer, writer io.Writer, err error) {
+	f, locator, err := t.sink.Create(t.TaskGroupID, fmt.Sprintf("%s.resume%d", t.Component.zipFilename(), attempt))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	zw = zip.NewWriter(f)
+	writer, err = zw.Create(fmt.Sprintf("%s.resume%d", t.Component.logFilename(), attempt))
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	t.SavedPathFragments = append(t.SavedPathFragments, locator)
+	return f, zw, writer, nil
+}
+
+// SavedPaths returns every sink locator this Task has written to, in write order: the
+// original zip plus any .resumeN fragments created by reopenForAppend after a restart. The
+// download/preview API should concatenate them in this order; clean() removes all of them.
+func (t *Task) SavedPaths() []string {
+	if len(t.SavedPathFragments) > 0 {
+		return t.SavedPathFragments
+	}
+	if t.SavedPath != "" {
+		return []string{t.SavedPath}
+	}
+	return nil
+}
+
+// Resume re-attaches to a Task that was left in StateRunning when the dashboard process
+// exited, e.g. after a restart. It is called by the scheduler instead of run() for tasks
+// loaded from the database in that state.
+func (t *Task) Resume() {
+	t.run()
+}
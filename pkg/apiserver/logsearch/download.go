@@ -0,0 +1,69 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Open streams t's saved log fragments back through its sink, in the order they were
+// written (the original zip plus any .resumeN continuations), so that a download handler
+// never has to know whether TaskModel.SavedPath is a local path or an object storage
+// locator. Callers must Close every returned reader.
+func (t *Task) Open(ctx context.Context) ([]io.ReadCloser, error) {
+	if t.sink == nil {
+		t.sink = defaultSink
+	}
+	paths := t.SavedPaths()
+	readers := make([]io.ReadCloser, 0, len(paths))
+	for _, savedPath := range paths {
+		r, err := t.sink.Open(ctx, savedPath)
+		if err != nil {
+			for _, opened := range readers {
+				opened.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, r)
+	}
+	return readers, nil
+}
+
+// ServeDownload writes t's saved log fragments to w as a single response, in the same
+// write order Open returns them in. It is the download API's entry point, replacing the
+// old behavior of treating TaskModel.SavedPath as a raw filesystem path that a LogSink
+// other than local disk can no longer satisfy.
+func (t *Task) ServeDownload(w http.ResponseWriter, r *http.Request) {
+	readers, err := t.Open(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		for _, rc := range readers {
+			rc.Close()
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.Component.zipFilename()))
+	for _, rc := range readers {
+		if _, err := io.Copy(w, rc); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTaskOpenStreamsThroughSink(t *testing.T) {
+	logsSavePath = t.TempDir()
+	sink := newLocalFileSink()
+
+	w, locator, err := sink.Create("group1", "1.1.1.1-20160.zip")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := w.Write([]byte("zip-bytes")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	task := &Task{
+		TaskModel: &TaskModel{SavedPath: locator},
+		sink:      sink,
+	}
+
+	readers, err := task.Open(context.Background())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(readers) != 1 {
+		t.Fatalf("expected 1 reader, got %d", len(readers))
+	}
+	defer readers[0].Close()
+
+	content, err := ioutil.ReadAll(readers[0])
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(content) != "zip-bytes" {
+		t.Fatalf("expected %q, got %q", "zip-bytes", content)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+// LogFormat selects how toLine renders a streamed LogMessage into the zip entry.
+type LogFormat string
+
+const (
+	// FormatPlain is the original "[time] [level] message" text, kept as the default so
+	// existing zips downloaded by users don't change shape.
+	FormatPlain LogFormat = "plain"
+	// FormatNDJSON emits one JSON object per line, convenient for piping into log
+	// processors that don't understand the plaintext layout.
+	FormatNDJSON LogFormat = "ndjson"
+	// FormatLoki still writes plain lines into the zip, but additionally streams batches
+	// to TaskModel.LokiPushURL using the Loki push API.
+	FormatLoki LogFormat = "loki"
+)
+
+// ndjsonLine is the JSON shape written per line when Task.Format is FormatNDJSON.
+type ndjsonLine struct {
+	Ts        int64  `json:"ts"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Host      string `json:"host"`
+	Message   string `json:"message"`
+}
+
+// formatLine renders msg according to t.Format, defaulting to FormatPlain when unset.
+func (t *Task) formatLine(msg *diagnosticspb.LogMessage) string {
+	switch t.Format {
+	case FormatNDJSON:
+		line := ndjsonLine{
+			Ts:        msg.Time,
+			Level:     diagnosticspb.LogLevel_name[int32(msg.Level)],
+			Component: t.Component.ServerType,
+			Host:      t.Component.IP,
+			Message:   msg.Message,
+		}
+		b, err := json.Marshal(line)
+		if err != nil {
+			return toLine(msg)
+		}
+		return string(b) + "\n"
+	default:
+		return toLine(msg)
+	}
+}
+
+// lokiPushBatchSize and lokiPushInterval bound how large/how often a loki push is, trading
+// off ingest latency against request volume against the configured LokiPushURL.
+// lokiPushTimeout bounds a single POST so a slow or unreachable LokiPushURL can never stall
+// run()'s hot loop through push() indefinitely.
+const (
+	lokiPushBatchSize = 500
+	lokiPushInterval  = 5 * time.Second
+	lokiPushTimeout   = 10 * time.Second
+)
+
+// lokiStream is one `streams` entry of the Loki push API payload.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiPusher batches messages off a channel and POSTs them to a Loki push-API endpoint
+// concurrently with the zip write; it never blocks or fails the Task on push errors. push
+// drops a message rather than blocking when the channel is full, and send bounds every POST
+// with httpClient's timeout, so a hung or unreachable LokiPushURL can never stall run()'s
+// hot loop.
+type lokiPusher struct {
+	url        string
+	labels     map[string]string
+	msgCh      chan *diagnosticspb.LogMessage
+	doneCh     chan struct{}
+	httpClient *http.Client
+}
+
+func newLokiPusher(url string, component *Component) *lokiPusher {
+	p := &lokiPusher{
+		url: url,
+		labels: map[string]string{
+			"component": component.ServerType,
+			"instance":  component.address(),
+		},
+		msgCh:      make(chan *diagnosticspb.LogMessage, lokiPushBatchSize),
+		doneCh:     make(chan struct{}),
+		httpClient: &http.Client{Timeout: lokiPushTimeout},
+	}
+	go p.run()
+	return p
+}
+
+// push enqueues msg for the next batch, dropping it instead of blocking if msgCh is already
+// full so a backed-up Loki endpoint never stalls the caller's hot loop.
+func (p *lokiPusher) push(msg *diagnosticspb.LogMessage) {
+	select {
+	case p.msgCh <- msg:
+	default:
+		fmt.Printf("loki push channel full, dropping message for %s", p.url)
+	}
+}
+
+func (p *lokiPusher) close() {
+	close(p.msgCh)
+	<-p.doneCh
+}
+
+func (p *lokiPusher) run() {
+	defer close(p.doneCh)
+	ticker := time.NewTicker(lokiPushInterval)
+	defer ticker.Stop()
+	batch := make([]*diagnosticspb.LogMessage, 0, lokiPushBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		p.send(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case msg, ok := <-p.msgCh:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= lokiPushBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (p *lokiPusher) send(batch []*diagnosticspb.LogMessage) {
+	values := make([][2]string, 0, len(batch))
+	for _, msg := range batch {
+		values = append(values, [2]string{
+			strconv.FormatInt(msg.Time*int64(time.Millisecond), 10),
+			msg.Message,
+		})
+	}
+	body, err := json.Marshal(lokiPushRequest{
+		Streams: []lokiStream{{Stream: p.labels, Values: values}},
+	})
+	if err != nil {
+		return
+	}
+	resp, err := p.httpClient.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("loki push to %s failed: %s", p.url, err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+func newFormatTestTask(format LogFormat) *Task {
+	return &Task{
+		TaskModel: &TaskModel{
+			Component: &Component{ServerType: "tikv", IP: "1.1.1.1", Port: "20160"},
+			Format:    format,
+		},
+	}
+}
+
+func TestFormatLinePlain(t *testing.T) {
+	task := newFormatTestTask(FormatPlain)
+	msg := &diagnosticspb.LogMessage{Time: 1000, Level: diagnosticspb.LogLevel_INFO, Message: "hello"}
+
+	line := task.formatLine(msg)
+	if !strings.Contains(line, "hello") || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("unexpected plain line: %q", line)
+	}
+}
+
+func TestFormatLineNDJSON(t *testing.T) {
+	task := newFormatTestTask(FormatNDJSON)
+	msg := &diagnosticspb.LogMessage{Time: 1000, Level: diagnosticspb.LogLevel_INFO, Message: "hello"}
+
+	line := task.formatLine(msg)
+	var decoded ndjsonLine
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(line, "\n")), &decoded); err != nil {
+		t.Fatalf("expected valid JSON line, got %q: %v", line, err)
+	}
+	if decoded.Message != "hello" || decoded.Component != "tikv" || decoded.Host != "1.1.1.1" {
+		t.Fatalf("unexpected decoded ndjson line: %+v", decoded)
+	}
+}
+
+func TestFormatLineLokiFallsBackToPlain(t *testing.T) {
+	task := newFormatTestTask(FormatLoki)
+	msg := &diagnosticspb.LogMessage{Time: 1000, Level: diagnosticspb.LogLevel_INFO, Message: "hello"}
+
+	line := task.formatLine(msg)
+	if line != toLine(msg) {
+		t.Fatalf("expected loki format zip entry to fall back to the plain line, got %q", line)
+	}
+}
+
+func TestLokiPusherPushDropsRatherThanBlocks(t *testing.T) {
+	p := &lokiPusher{
+		url:    "http://127.0.0.1:0",
+		msgCh:  make(chan *diagnosticspb.LogMessage, 1),
+		doneCh: make(chan struct{}),
+	}
+	msg := &diagnosticspb.LogMessage{Time: 1000, Message: "hello"}
+
+	p.push(msg)
+	done := make(chan struct{})
+	go func() {
+		p.push(msg)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("push blocked on a full channel instead of dropping")
+	}
+	if len(p.msgCh) != 1 {
+		t.Fatalf("expected channel to stay at capacity 1, got %d", len(p.msgCh))
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+// indexDoc is the bleve document indexed for every LogMessage a Task streams in. It mirrors
+// the zip line format but keeps the fields separate so queries can filter by component and
+// level instead of only doing plaintext matching.
+type indexDoc struct {
+	TaskGroupID string    `json:"task_group_id"`
+	TaskID      string    `json:"task_id"`
+	Component   string    `json:"component"`
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Message     string    `json:"message"`
+}
+
+func indexFilename(c *Component) string {
+	return fmt.Sprintf("%s-%s.bleve", c.IP, c.Port)
+}
+
+// openTaskIndex creates (or reopens) the bleve index for a single task, stored next to its
+// zip under the same task group directory.
+func openTaskIndex(taskGroupID string, c *Component) (bleve.Index, error) {
+	dir := path.Join(logsSavePath, taskGroupID)
+	idxPath := path.Join(dir, indexFilename(c))
+	idx, err := bleve.Open(idxPath)
+	if err == nil {
+		return idx, nil
+	}
+	return bleve.New(idxPath, bleve.NewIndexMapping())
+}
+
+// openIndexRegistry tracks indexes currently held open by an in-progress Task, keyed by
+// TaskID. bleve takes an exclusive lock on its index directory, so SearchAcrossTasks must
+// route a still-running task's queries through its own already-open index rather than
+// trying (and failing) to reopen the same path from disk.
+var (
+	openIndexMu       sync.RWMutex
+	openIndexRegistry = make(map[string]bleve.Index)
+)
+
+func registerOpenIndex(taskID string, idx bleve.Index) {
+	openIndexMu.Lock()
+	openIndexRegistry[taskID] = idx
+	openIndexMu.Unlock()
+}
+
+func unregisterOpenIndex(taskID string) {
+	openIndexMu.Lock()
+	delete(openIndexRegistry, taskID)
+	openIndexMu.Unlock()
+}
+
+func liveIndex(taskID string) bleve.Index {
+	openIndexMu.RLock()
+	defer openIndexMu.RUnlock()
+	return openIndexRegistry[taskID]
+}
+
+// indexMessage adds one streamed LogMessage to the task's index. Indexing failures are
+// logged but never abort the Task; the zip remains the source of truth.
+func indexMessage(idx bleve.Index, taskGroupID, taskID string, c *Component, msg *diagnosticspb.LogMessage) {
+	if idx == nil {
+		return
+	}
+	doc := indexDoc{
+		TaskGroupID: taskGroupID,
+		TaskID:      taskID,
+		Component:   c.ServerType,
+		Time:        time.Unix(0, msg.Time*int64(time.Millisecond)),
+		Level:       diagnosticspb.LogLevel_name[int32(msg.Level)],
+		Message:     msg.Message,
+	}
+	docID := fmt.Sprintf("%s-%d", taskID, msg.Time)
+	if err := idx.Index(docID, doc); err != nil {
+		fmt.Printf("task [%s] failed to index log line: %s", taskID, err)
+	}
+}
+
+// SearchHit is one ranked result returned by SearchAcrossTasks.
+type SearchHit struct {
+	TaskID    string    `json:"task_id"`
+	Component string    `json:"component"`
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Score     float64   `json:"score"`
+}
+
+// searchMinTime and searchMaxTime stand in for "no bound" on either side of a time range
+// query. bleve's DateRangeQuery is built from two time.Time values with no way to omit one
+// of them outright, so a genuinely unbounded side must be given a value wide enough to
+// never exclude a real log line rather than the zero time.Time{}, which represents a real
+// (and very restrictive) instant, year 1 AD.
+var (
+	searchMinTime = time.Unix(0, 0)
+	searchMaxTime = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// timeRangeQuery builds a DateRangeQuery for [startTime, endTime], substituting
+// searchMinTime/searchMaxTime for whichever bound the caller left zero. It returns nil when
+// neither bound is set, so callers can skip adding a range clause entirely.
+func timeRangeQuery(startTime, endTime time.Time) bleve.Query {
+	if startTime.IsZero() && endTime.IsZero() {
+		return nil
+	}
+	if startTime.IsZero() {
+		startTime = searchMinTime
+	}
+	if endTime.IsZero() {
+		endTime = searchMaxTime
+	}
+	return bleve.NewDateRangeQuery(startTime, endTime)
+}
+
+// SearchAcrossTasks queries every component's index within a task group and returns merged,
+// relevance-ranked hits, optionally narrowed to a time range and a set of log levels. It
+// replaces paging through PreviewLogLinesLimit lines per component.
+func SearchAcrossTasks(taskGroupID, query string, startTime, endTime time.Time, levels []string) ([]SearchHit, error) {
+	tasks, err := dbClient.getTasksByTaskGroupID(taskGroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, 0)
+	for _, t := range tasks {
+		idx := liveIndex(t.TaskID)
+		closeAfter := false
+		if idx == nil {
+			idx, err = openTaskIndex(taskGroupID, t.Component)
+			if err != nil {
+				continue
+			}
+			closeAfter = true
+		}
+
+		taskHits, err := searchTaskIndex(idx, query, startTime, endTime, levels)
+		if closeAfter {
+			idx.Close()
+		}
+		if err != nil {
+			continue
+		}
+		hits = append(hits, taskHits...)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits, nil
+}
+
+// searchTaskIndex runs one component's share of a SearchAcrossTasks query against an
+// already-open index, pulled out of SearchAcrossTasks so it can be exercised directly
+// against a test index without a dbClient.
+func searchTaskIndex(idx bleve.Index, query string, startTime, endTime time.Time, levels []string) ([]SearchHit, error) {
+	q := bleve.NewConjunctionQuery(bleve.NewQueryStringQuery(query))
+	if rangeQuery := timeRangeQuery(startTime, endTime); rangeQuery != nil {
+		q.AddQuery(rangeQuery)
+	}
+	for _, level := range levels {
+		q.AddQuery(bleve.NewQueryStringQuery(fmt.Sprintf("level:%s", level)))
+	}
+	req := bleve.NewSearchRequest(q)
+	req.Fields = []string{"task_id", "component", "time", "level", "message"}
+	result, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		hits = append(hits, SearchHit{
+			TaskID:    fmt.Sprintf("%v", h.Fields["task_id"]),
+			Component: fmt.Sprintf("%v", h.Fields["component"]),
+			Time:      parseHitTime(h.Fields["time"]),
+			Level:     fmt.Sprintf("%v", h.Fields["level"]),
+			Message:   fmt.Sprintf("%v", h.Fields["message"]),
+			Score:     h.Score,
+		})
+	}
+	return hits, nil
+}
+
+// parseHitTime recovers the indexed Time field from a bleve hit, which comes back as an
+// RFC3339 string regardless of the original time.Time value indexed.
+func parseHitTime(field interface{}) time.Time {
+	s, ok := field.(string)
+	if !ok {
+		return time.Time{}
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
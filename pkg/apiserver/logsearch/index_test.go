@@ -0,0 +1,135 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+func newTestIndex(t *testing.T) bleve.Index {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatalf("bleve.NewMemOnly: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func TestIndexMessage(t *testing.T) {
+	idx := newTestIndex(t)
+	component := &Component{ServerType: "tikv", IP: "1.1.1.1", Port: "20160"}
+	msg := &diagnosticspb.LogMessage{
+		Time:    1000,
+		Level:   diagnosticspb.LogLevel_INFO,
+		Message: "region split finished",
+	}
+
+	indexMessage(idx, "group1", "task1", component, msg)
+
+	hits, err := searchTaskIndex(idx, "split", time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("searchTaskIndex: %v", err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(hits))
+	}
+	if hits[0].TaskID != "task1" || hits[0].Component != "tikv" || hits[0].Message != "region split finished" {
+		t.Fatalf("unexpected hit: %+v", hits[0])
+	}
+}
+
+func TestIndexMessageNilIndexIsNoop(t *testing.T) {
+	// indexMessage must tolerate a nil index (openTaskIndex failed) without panicking,
+	// since indexing is best-effort and must never fail the Task.
+	indexMessage(nil, "group1", "task1", &Component{}, &diagnosticspb.LogMessage{Time: 1000})
+}
+
+func TestSearchTaskIndexOpenEndedTimeRange(t *testing.T) {
+	idx := newTestIndex(t)
+	component := &Component{ServerType: "tikv", IP: "1.1.1.1", Port: "20160"}
+	old := &diagnosticspb.LogMessage{Time: 1000, Message: "old entry"}
+	recent := &diagnosticspb.LogMessage{Time: time.Now().Unix() * 1000, Message: "recent entry"}
+	indexMessage(idx, "group1", "task1", component, old)
+	indexMessage(idx, "group1", "task1", component, recent)
+
+	// No bounds at all: both entries come back.
+	hits, err := searchTaskIndex(idx, "entry", time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("searchTaskIndex: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("expected both entries with no time bound, got %d", len(hits))
+	}
+
+	// Only a lower bound, set after `old`: searchMaxTime must still admit `recent`.
+	hits, err = searchTaskIndex(idx, "entry", time.Unix(0, recent.Time*int64(time.Millisecond)).Add(-time.Second), time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("searchTaskIndex: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Message != "recent entry" {
+		t.Fatalf("expected only the recent entry with an open-ended upper bound, got %+v", hits)
+	}
+}
+
+func TestSearchTaskIndexFiltersByLevel(t *testing.T) {
+	idx := newTestIndex(t)
+	component := &Component{ServerType: "tikv", IP: "1.1.1.1", Port: "20160"}
+	indexMessage(idx, "group1", "task1", component, &diagnosticspb.LogMessage{Time: 1000, Level: diagnosticspb.LogLevel_INFO, Message: "entry one"})
+	indexMessage(idx, "group1", "task1", component, &diagnosticspb.LogMessage{Time: 2000, Level: diagnosticspb.LogLevel_ERROR, Message: "entry two"})
+
+	hits, err := searchTaskIndex(idx, "entry", time.Time{}, time.Time{}, []string{"ERROR"})
+	if err != nil {
+		t.Fatalf("searchTaskIndex: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Message != "entry two" {
+		t.Fatalf("expected only the ERROR-level entry, got %+v", hits)
+	}
+}
+
+// TestLiveIndexRoutesToOpenIndex mirrors the path SearchAcrossTasks takes while a Task is
+// still running: its index is looked up via liveIndex instead of being reopened from disk,
+// which would otherwise collide with the Task's own open bleve.Index handle.
+func TestLiveIndexRoutesToOpenIndex(t *testing.T) {
+	idx := newTestIndex(t)
+	component := &Component{ServerType: "tikv", IP: "1.1.1.1", Port: "20160"}
+	indexMessage(idx, "group1", "task1", component, &diagnosticspb.LogMessage{Time: 1000, Message: "streaming in"})
+
+	if liveIndex("task1") != nil {
+		t.Fatalf("expected no live index registered yet")
+	}
+
+	registerOpenIndex("task1", idx)
+	defer unregisterOpenIndex("task1")
+
+	found := liveIndex("task1")
+	if found == nil {
+		t.Fatalf("expected liveIndex to return the registered index")
+	}
+	hits, err := searchTaskIndex(found, "streaming", time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("searchTaskIndex: %v", err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit via the live index, got %d", len(hits))
+	}
+
+	unregisterOpenIndex("task1")
+	if liveIndex("task1") != nil {
+		t.Fatalf("expected liveIndex to return nil after unregister")
+	}
+}
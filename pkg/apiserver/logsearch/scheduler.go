@@ -0,0 +1,185 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ProgressEvent is emitted by a running Task as it writes lines, and once more with its
+// final State when it stops. It is what TaskGroupScheduler forwards to subscribers of a
+// task group's progress stream.
+type ProgressEvent struct {
+	TaskID       string    `json:"task_id"`
+	BytesWritten int64     `json:"bytes_written"`
+	LinesWritten int64     `json:"lines_written"`
+	State        TaskState `json:"state"`
+}
+
+// TaskGroupScheduler runs the Tasks of one task group with bounded parallelism, instead of
+// the previous implicit "spawn a goroutine per Task" which could fan out to as many
+// simultaneous gRPC streams as there are components in the group. MaxConcurrentPerHost
+// limits how many Tasks may run against the same IP at once (several TiKV/TiDB instances
+// can share a host); MaxConcurrentTotal bounds the group as a whole.
+type TaskGroupScheduler struct {
+	MaxConcurrentPerHost int
+	MaxConcurrentTotal   int
+
+	mu       sync.Mutex
+	hostSems map[string]chan struct{}
+	totalSem chan struct{}
+
+	progressCh chan ProgressEvent
+	wg         sync.WaitGroup
+
+	// runFunc and resumeFunc, when set, replace the real Task.run/Task.Resume dispatch in
+	// runOne. They exist so tests can drive Run's concurrency bookkeeping with fake, fast
+	// tasks instead of dialing real gRPC connections; nil (the zero value) means use the
+	// real methods.
+	runFunc    func(*Task)
+	resumeFunc func(*Task)
+}
+
+// NewTaskGroupScheduler builds a scheduler bounding concurrency as described above. A
+// non-positive limit is treated as unbounded.
+func NewTaskGroupScheduler(maxConcurrentPerHost, maxConcurrentTotal int) *TaskGroupScheduler {
+	s := &TaskGroupScheduler{
+		MaxConcurrentPerHost: maxConcurrentPerHost,
+		MaxConcurrentTotal:   maxConcurrentTotal,
+		hostSems:             make(map[string]chan struct{}),
+		progressCh:           make(chan ProgressEvent, 64),
+	}
+	if maxConcurrentTotal > 0 {
+		s.totalSem = make(chan struct{}, maxConcurrentTotal)
+	}
+	return s
+}
+
+func (s *TaskGroupScheduler) hostSem(host string) chan struct{} {
+	if s.MaxConcurrentPerHost <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.hostSems[host]
+	if !ok {
+		sem = make(chan struct{}, s.MaxConcurrentPerHost)
+		s.hostSems[host] = sem
+	}
+	return sem
+}
+
+// Progress returns the channel that ProgressEvents are published on. It is closed once
+// Run's tasks have all finished and Wait has returned.
+func (s *TaskGroupScheduler) Progress() <-chan ProgressEvent {
+	return s.progressCh
+}
+
+// Run starts every task in the group in its own goroutine, which waits on the per-host and
+// total semaphores as needed; Run itself returns immediately. Use Wait to block until they
+// have all stopped.
+func (s *TaskGroupScheduler) Run(tasks []*Task) {
+	for _, t := range tasks {
+		t := t
+		t.progress = s.progressCh
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runOne(t)
+		}()
+	}
+}
+
+func (s *TaskGroupScheduler) runOne(t *Task) {
+	if sem := s.hostSem(t.Component.IP); sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+	if s.totalSem != nil {
+		s.totalSem <- struct{}{}
+		defer func() { <-s.totalSem }()
+	}
+	// A task already in StateRunning was loaded from the database after a dashboard
+	// restart interrupted it mid-stream; Resume() picks it back up from its last
+	// checkpoint instead of starting it over as a brand new fetch.
+	if t.State == StateRunning {
+		if s.resumeFunc != nil {
+			s.resumeFunc(t)
+			return
+		}
+		t.Resume()
+		return
+	}
+	if s.runFunc != nil {
+		s.runFunc(t)
+		return
+	}
+	t.run()
+}
+
+// Wait blocks until every Task started by Run has stopped, then closes the progress
+// channel so anything draining Progress() can stop too.
+func (s *TaskGroupScheduler) Wait() {
+	s.wg.Wait()
+	close(s.progressCh)
+}
+
+// Abort cancels every running task in the group concurrently and waits for each to
+// acknowledge, generalizing Task.Abort's single-task doneCh handshake to the whole group.
+func (s *TaskGroupScheduler) Abort(tasks []*Task) {
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		t := t
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = t.Abort()
+		}()
+	}
+	wg.Wait()
+}
+
+// ServeProgressSSE streams ProgressEvents to the client as Server-Sent Events until either
+// the request context is canceled or Progress() is closed by Wait. The UI uses this to
+// render live per-task progress bars instead of polling TaskModel.State.
+func (s *TaskGroupScheduler) ServeProgressSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for {
+		select {
+		case ev, ok := <-s.progressCh:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
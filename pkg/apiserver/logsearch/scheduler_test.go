@@ -0,0 +1,123 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskGroupSchedulerHostSemCapacity(t *testing.T) {
+	s := NewTaskGroupScheduler(2, 0)
+
+	sem := s.hostSem("1.1.1.1")
+	if cap(sem) != 2 {
+		t.Fatalf("expected per-host capacity 2, got %d", cap(sem))
+	}
+	if same := s.hostSem("1.1.1.1"); same != sem {
+		t.Fatalf("expected the same semaphore to be reused for the same host")
+	}
+	if other := s.hostSem("2.2.2.2"); other == sem {
+		t.Fatalf("expected a distinct semaphore for a different host")
+	}
+}
+
+func TestTaskGroupSchedulerUnboundedWhenNonPositive(t *testing.T) {
+	s := NewTaskGroupScheduler(0, 0)
+
+	if sem := s.hostSem("1.1.1.1"); sem != nil {
+		t.Fatalf("expected no per-host semaphore when MaxConcurrentPerHost <= 0, got %v", sem)
+	}
+	if s.totalSem != nil {
+		t.Fatalf("expected no total semaphore when MaxConcurrentTotal <= 0, got %v", s.totalSem)
+	}
+}
+
+func TestTaskGroupSchedulerTotalSemCapacity(t *testing.T) {
+	s := NewTaskGroupScheduler(0, 3)
+
+	if cap(s.totalSem) != 3 {
+		t.Fatalf("expected total capacity 3, got %d", cap(s.totalSem))
+	}
+}
+
+func newSchedulerTestTask(ip string) *Task {
+	return &Task{
+		TaskModel: &TaskModel{
+			Component: &Component{IP: ip},
+		},
+		mu: sync.Mutex{},
+	}
+}
+
+// TestTaskGroupSchedulerRunEnforcesConcurrency drives several slow fake tasks through Run
+// and asserts that the observed peak concurrency never exceeds MaxConcurrentTotal, not just
+// that the semaphore was constructed with the right capacity.
+func TestTaskGroupSchedulerRunEnforcesConcurrency(t *testing.T) {
+	const maxConcurrentTotal = 2
+	s := NewTaskGroupScheduler(0, maxConcurrentTotal)
+
+	var current, peak int32
+	s.runFunc = func(*Task) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+	}
+
+	tasks := make([]*Task, 0, 8)
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, newSchedulerTestTask("1.1.1.1"))
+	}
+	s.Run(tasks)
+	s.Wait()
+
+	if peak > maxConcurrentTotal {
+		t.Fatalf("expected peak concurrency <= %d, observed %d", maxConcurrentTotal, peak)
+	}
+	if peak < maxConcurrentTotal {
+		t.Fatalf("expected peak concurrency to reach %d, observed %d", maxConcurrentTotal, peak)
+	}
+}
+
+// TestTaskGroupSchedulerRunResumesRunningTasks asserts that runOne dispatches a
+// StateRunning task to Resume rather than starting it over via run.
+func TestTaskGroupSchedulerRunResumesRunningTasks(t *testing.T) {
+	s := NewTaskGroupScheduler(0, 0)
+
+	var resumed, ran int32
+	s.resumeFunc = func(*Task) { atomic.AddInt32(&resumed, 1) }
+	s.runFunc = func(*Task) { atomic.AddInt32(&ran, 1) }
+
+	running := newSchedulerTestTask("1.1.1.1")
+	running.State = StateRunning
+	fresh := newSchedulerTestTask("1.1.1.1") // zero-value State: not yet started
+
+	s.Run([]*Task{running, fresh})
+	s.Wait()
+
+	if resumed != 1 {
+		t.Fatalf("expected exactly 1 task dispatched to resumeFunc, got %d", resumed)
+	}
+	if ran != 1 {
+		t.Fatalf("expected exactly 1 task dispatched to runFunc, got %d", ran)
+	}
+}
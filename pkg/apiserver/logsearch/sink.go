@@ -0,0 +1,284 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// LogSink abstracts where a Task's collected log zip lives. The local disk under
+// logsSavePath is ephemeral in containerized deployments, so a Task may instead be
+// configured to write through to object storage shared by every dashboard replica.
+type LogSink interface {
+	// Create opens a new object for the given task group and filename for writing, and
+	// returns the URL-style locator that should be persisted as TaskModel.SavedPath, e.g.
+	// "file:///data/logs/g1/1.1.1.1-4000.zip" or "s3://bucket/g1/1.1.1.1-4000.zip".
+	Create(taskGroupID, filename string) (io.WriteCloser, string, error)
+	// Open reopens a previously created locator for reading, used by the download and
+	// preview APIs.
+	Open(ctx context.Context, savedPath string) (io.ReadCloser, error)
+	// Remove deletes the object at savedPath. It is not an error to remove a locator that
+	// does not exist.
+	Remove(savedPath string) error
+}
+
+// localFileSink stores zips on local disk under logsSavePath, the behavior this package
+// always had before pluggable sinks were introduced.
+type localFileSink struct{}
+
+func newLocalFileSink() LogSink {
+	return &localFileSink{}
+}
+
+func (s *localFileSink) Create(taskGroupID, filename string) (io.WriteCloser, string, error) {
+	dir := path.Join(logsSavePath, taskGroupID)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, "", err
+	}
+	savedPath := path.Join(dir, filename)
+	f, err := os.Create(savedPath)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, "file://" + savedPath, nil
+}
+
+func (s *localFileSink) Open(_ context.Context, savedPath string) (io.ReadCloser, error) {
+	return os.Open(strings.TrimPrefix(savedPath, "file://"))
+}
+
+func (s *localFileSink) Remove(savedPath string) error {
+	return os.RemoveAll(strings.TrimPrefix(savedPath, "file://"))
+}
+
+// ObjectStorageConfig configures an S3-compatible (AWS S3, Aliyun OSS, MinIO) or GCS sink.
+type ObjectStorageConfig struct {
+	// Scheme selects the backend: "s3", "oss" or "gcs". "oss" is handled by the same
+	// client as "s3" since Aliyun OSS speaks the S3 API.
+	Scheme string
+	Bucket string
+	// Endpoint overrides the S3 API endpoint for "s3"/"oss" (e.g. a MinIO or OSS endpoint);
+	// when empty, the AWS SDK's default endpoint for Region is used. It is ignored for
+	// "gcs", which always talks to Google's default endpoint.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	AccessKeySecret string
+}
+
+// objectStorageSink stores zips in an S3-compatible bucket (S3, OSS, MinIO) or GCS, keyed
+// by "<taskGroupID>/<filename>". The concrete client is injected through
+// objectStorageClient, so the sink logic itself does not depend on a particular SDK.
+type objectStorageSink struct {
+	cfg    ObjectStorageConfig
+	client objectStorageClient
+}
+
+// objectStorageClient is the minimal surface newObjectStorageSink needs from an SDK client.
+// Production wiring constructs this from the AWS SDK (s3manager) for "s3"/"oss" and from
+// cloud.google.com/go/storage for "gcs".
+type objectStorageClient interface {
+	PutObject(bucket, key string) (io.WriteCloser, error)
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	DeleteObject(bucket, key string) error
+}
+
+func newObjectStorageSink(cfg ObjectStorageConfig, client objectStorageClient) LogSink {
+	return &objectStorageSink{cfg: cfg, client: client}
+}
+
+func (s *objectStorageSink) key(taskGroupID, filename string) string {
+	return path.Join(taskGroupID, filename)
+}
+
+func (s *objectStorageSink) Create(taskGroupID, filename string) (io.WriteCloser, string, error) {
+	key := s.key(taskGroupID, filename)
+	w, err := s.client.PutObject(s.cfg.Bucket, key)
+	if err != nil {
+		return nil, "", err
+	}
+	locator := fmt.Sprintf("%s://%s/%s", s.cfg.Scheme, s.cfg.Bucket, key)
+	return w, locator, nil
+}
+
+func (s *objectStorageSink) Open(ctx context.Context, savedPath string) (io.ReadCloser, error) {
+	u, err := url.Parse(savedPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+}
+
+func (s *objectStorageSink) Remove(savedPath string) error {
+	u, err := url.Parse(savedPath)
+	if err != nil {
+		return err
+	}
+	return s.client.DeleteObject(u.Host, strings.TrimPrefix(u.Path, "/"))
+}
+
+// NewObjectStorageSink builds a LogSink from cfg, wiring up the AWS SDK for "s3"/"oss"
+// (Aliyun OSS and MinIO both speak the S3 API, so only the endpoint differs) or the GCS
+// client library for "gcs". This is what dashboard config should call before SetDefaultSink
+// when log sinks are pointed at object storage.
+func NewObjectStorageSink(cfg ObjectStorageConfig) (LogSink, error) {
+	switch cfg.Scheme {
+	case "s3", "oss":
+		client, err := newAWSObjectClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newObjectStorageSink(cfg, client), nil
+	case "gcs":
+		client, err := newGCSObjectClient(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return newObjectStorageSink(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("unsupported object storage scheme %q", cfg.Scheme)
+	}
+}
+
+// awsObjectClient implements objectStorageClient on top of the AWS SDK. Pointing Endpoint at
+// a MinIO or Aliyun OSS address (with path-style addressing) makes this the same client for
+// "s3" and "oss" since both speak the S3 API.
+type awsObjectClient struct {
+	uploader *s3manager.Uploader
+	svc      *s3.S3
+}
+
+func newAWSObjectClient(cfg ObjectStorageConfig) (*awsObjectClient, error) {
+	awsCfg := aws.NewConfig().
+		WithRegion(cfg.Region).
+		WithS3ForcePathStyle(true)
+	if cfg.AccessKeyID != "" {
+		awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.AccessKeySecret, ""))
+	}
+	if cfg.Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &awsObjectClient{
+		uploader: s3manager.NewUploader(sess),
+		svc:      s3.New(sess),
+	}, nil
+}
+
+// PutObject streams writes straight into an s3manager upload via an in-memory pipe, so
+// callers can write()/Close() without buffering the whole zip first.
+func (c *awsObjectClient) PutObject(bucket, key string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		_ = pr.CloseWithError(err)
+		done <- err
+	}()
+	return &pipeUploadWriter{pw: pw, done: done}, nil
+}
+
+func (c *awsObjectClient) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := c.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (c *awsObjectClient) DeleteObject(bucket, key string) error {
+	_, err := c.svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	return err
+}
+
+// pipeUploadWriter makes an s3manager upload running in a background goroutine look like a
+// plain io.WriteCloser; Close blocks until the upload finishes so callers observe its error.
+type pipeUploadWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *pipeUploadWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *pipeUploadWriter) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+// gcsObjectClient implements objectStorageClient on top of cloud.google.com/go/storage.
+type gcsObjectClient struct {
+	client *storage.Client
+}
+
+func newGCSObjectClient(ctx context.Context) (*gcsObjectClient, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsObjectClient{client: client}, nil
+}
+
+func (c *gcsObjectClient) PutObject(bucket, key string) (io.WriteCloser, error) {
+	return c.client.Bucket(bucket).Object(key).NewWriter(context.Background()), nil
+}
+
+func (c *gcsObjectClient) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return c.client.Bucket(bucket).Object(key).NewReader(ctx)
+}
+
+func (c *gcsObjectClient) DeleteObject(bucket, key string) error {
+	err := c.client.Bucket(bucket).Object(key).Delete(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
+
+// defaultSink is the LogSink new tasks are created with. It defaults to local disk so
+// existing single-replica deployments keep working unchanged; SetDefaultSink lets the
+// dashboard's global config point it at S3/OSS/GCS instead.
+var defaultSink LogSink = newLocalFileSink()
+
+// SetDefaultSink overrides the sink used by tasks created after this call, including tasks
+// rebuilt from the database by ToTask. Tasks created before the call keep the sink they were
+// created with; a task built afterwards opens and removes its locators through the new
+// sink, whatever sink originally wrote them.
+func SetDefaultSink(sink LogSink) {
+	defaultSink = sink
+}
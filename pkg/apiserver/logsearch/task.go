@@ -26,7 +26,6 @@ import (
 	"github.com/google/uuid"
 	"github.com/pingcap/kvproto/pkg/diagnosticspb"
 	"github.com/pingcap/sysutil"
-	"google.golang.org/grpc"
 )
 
 func (c *Component) address() string {
@@ -47,9 +46,16 @@ func (c *Component) logFilename() string {
 
 type Task struct {
 	*TaskModel
-	mu     sync.Mutex
-	cancel context.CancelFunc
-	doneCh chan struct{}
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	doneCh   chan struct{}
+	sink     LogSink
+	progress chan<- ProgressEvent
+
+	// bytesWritten and linesWritten mirror the totals last reported to emitProgress, kept on
+	// the Task itself so close() can report the real final counters instead of guessing 0, 0.
+	bytesWritten int64
+	linesWritten int64
 }
 
 func NewTask(component *Component, taskGroupID string, req *SearchLogRequest) *Task {
@@ -61,7 +67,8 @@ func NewTask(component *Component, taskGroupID string, req *SearchLogRequest) *T
 			TaskID:      uuid.New().String(),
 			CreateTime:  time.Now().Unix(),
 		},
-		mu: sync.Mutex{},
+		mu:   sync.Mutex{},
+		sink: defaultSink,
 	}
 }
 
@@ -69,6 +76,7 @@ func ToTask(t *TaskModel) *Task {
 	return &Task{
 		TaskModel: t,
 		mu:        sync.Mutex{},
+		sink:      defaultSink,
 	}
 }
 
@@ -83,6 +91,20 @@ func (t *Task) Abort() error {
 	return fmt.Errorf("task [%s] is not running", t.TaskID)
 }
 
+// emitProgress reports a ProgressEvent to the TaskGroupScheduler this Task was launched
+// from, if any; standalone tasks created directly with NewTask simply have no subscriber.
+func (t *Task) emitProgress(bytesWritten, linesWritten int64) {
+	if t.progress == nil {
+		return
+	}
+	t.progress <- ProgressEvent{
+		TaskID:       t.TaskID,
+		BytesWritten: bytesWritten,
+		LinesWritten: linesWritten,
+		State:        t.State,
+	}
+}
+
 func (t *Task) done() {
 	if t.doneCh != nil {
 		t.doneCh <- struct{}{}
@@ -99,6 +121,7 @@ func (t *Task) close() {
 		t.State = StateCanceled
 		dbClient.updateTask(t.TaskModel)
 		t.mu.Unlock()
+		t.emitProgress(t.bytesWritten, t.linesWritten)
 		return
 	}
 	t.StopTime = time.Now().Unix()
@@ -106,16 +129,19 @@ func (t *Task) close() {
 	t.State = StateFinished
 	dbClient.updateTask(t.TaskModel)
 	t.mu.Unlock()
+	t.emitProgress(t.bytesWritten, t.linesWritten)
 }
 
 func (t *Task) clean() error {
 	var err error
-	if t.SavedPath != "" {
-		err = os.RemoveAll(t.SavedPath)
-		if err != nil {
-			return err
+	for _, savedPath := range t.SavedPaths() {
+		if rerr := t.sink.Remove(savedPath); rerr != nil {
+			err = rerr
 		}
 	}
+	if t.Component != nil {
+		_ = os.RemoveAll(path.Join(logsSavePath, t.TaskGroupID, indexFilename(t.Component)))
+	}
 	dbClient.cleanPreview(t.TaskID)
 	return err
 }
@@ -126,45 +152,60 @@ func (t *Task) run() {
 	defer t.close()
 	var ctx context.Context
 	ctx, t.cancel = context.WithCancel(context.Background())
-	opt := grpc.WithInsecure()
 
-	conn, err := grpc.Dial(t.Component.address(), opt)
-	if err != nil {
-		t.Error = err.Error()
-		return
+	if t.RetryPolicy.MaxAttempts == 0 {
+		t.RetryPolicy = DefaultRetryPolicy
 	}
-	defer conn.Close()
-	cli := diagnosticspb.NewDiagnosticsClient(conn)
-	stream, err := cli.SearchLog(ctx, (*diagnosticspb.SearchLogRequest)(t.Request))
+	conn, stream, err := t.dial(ctx, t.effectiveStartTime())
 	if err != nil {
 		t.Error = err.Error()
 		return
 	}
+	defer conn.Close()
 
-	dir := path.Join(logsSavePath, t.TaskGroupID)
-	err = os.MkdirAll(dir, 0777)
-	if err != nil {
-		t.Error = err.Error()
-		return
+	if t.sink == nil {
+		t.sink = defaultSink
+	}
+	var f io.WriteCloser
+	var zw *zip.Writer
+	var writer io.Writer
+	if t.SavedPath != "" {
+		// This Task was already running before a dashboard restart interrupted it:
+		// the previous zip.Writer is gone, so continue into a new entry alongside it
+		// rather than reopening (and truncating) the original.
+		t.ResumeCount++
+		f, zw, writer, err = t.reopenForAppend(t.ResumeCount)
+	} else {
+		var savedPath string
+		f, savedPath, err = t.sink.Create(t.TaskGroupID, t.Component.zipFilename())
+		if err == nil {
+			zw = zip.NewWriter(f)
+			writer, err = zw.Create(t.Component.logFilename())
+			t.SavedPath = savedPath
+			t.SavedPathFragments = append(t.SavedPathFragments, savedPath)
+		}
 	}
-	savedPath := path.Join(dir, t.Component.zipFilename())
-	f, err := os.Create(savedPath)
 	if err != nil {
 		t.Error = err.Error()
 		return
 	}
 	defer f.Close()
-	zw := zip.NewWriter(f)
 	defer zw.Close()
-	writer, err := zw.Create(t.Component.logFilename())
-	if err != nil {
-		t.Error = err.Error()
-		return
+
+	idx, idxErr := openTaskIndex(t.TaskGroupID, t.Component)
+	if idxErr != nil {
+		// Indexing is a best-effort enhancement on top of the zip; do not fail the task.
+		fmt.Printf("task [%s] failed to open index: %s", t.TaskID, idxErr)
+	} else {
+		registerOpenIndex(t.TaskID, idx)
+		defer idx.Close()
+		defer unregisterOpenIndex(t.TaskID)
 	}
-	t.SavedPath = savedPath
-	if err != nil {
-		t.Error = err.Error()
-		return
+
+	var pusher *lokiPusher
+	if t.Format == FormatLoki && t.LokiPushURL != "" {
+		pusher = newLokiPusher(t.LokiPushURL, t.Component)
+		defer pusher.close()
 	}
 
 	t.StartTime = time.Now().Unix()
@@ -179,32 +220,62 @@ func (t *Task) run() {
 	}
 
 	previewLogLinesCount := 0
+	linesSinceCheckpoint := 0
+	attempt := 0
 	for {
 		res, err := stream.Recv()
 		if err != nil {
-			if err != io.EOF {
+			if err == io.EOF {
+				return
+			}
+			if attempt >= t.RetryPolicy.MaxAttempts {
 				t.Error = err.Error()
+				return
 			}
-			return
+			time.Sleep(t.RetryPolicy.backoff(attempt))
+			attempt++
+			conn.Close()
+			conn, stream, err = t.dial(ctx, t.effectiveStartTime())
+			if err != nil {
+				t.Error = err.Error()
+				return
+			}
+			continue
 		}
+		// A successful Recv means the stream is healthy again; treat each transient
+		// incident as resolved rather than letting MaxAttempts act as a lifetime budget
+		// for a task that may run for days and hit a handful of isolated blips.
+		attempt = 0
 		for _, msg := range res.Messages {
-			line := toLine(msg)
+			line := t.formatLine(msg)
 			// TODO: use unsafe here: string -> []byte
-			_, err := writer.Write([]byte(line))
+			n, err := writer.Write([]byte(line))
 			if err != nil {
 				t.Error = err.Error()
 				return
 			}
+			t.bytesWritten += int64(n)
+			t.linesWritten++
 			if previewLogLinesCount < PreviewLogLinesLimit {
 				dbClient.newPreview(t.TaskID, msg)
 				previewLogLinesCount++
 			}
+			indexMessage(idx, t.TaskGroupID, t.TaskID, t.Component, msg)
+			if pusher != nil {
+				pusher.push(msg)
+			}
+			linesSinceCheckpoint++
+			if linesSinceCheckpoint >= checkpointEvery {
+				t.checkpoint(msg.Time)
+				linesSinceCheckpoint = 0
+			}
 		}
 		err = zw.Flush()
 		if err != nil {
 			t.Error = err.Error()
 			return
 		}
+		t.emitProgress(t.bytesWritten, t.linesWritten)
 	}
 }
 